@@ -0,0 +1,107 @@
+package main
+
+import "testing"
+
+func TestSinkCompression(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"dump.sql", ""},
+		{"dump.sql.gz", "gzip"},
+		{"dump.sql.zst", "zstd"},
+		{"s3://bucket/dump.sql.gz", "gzip"},
+	}
+
+	for _, c := range cases {
+		if got := sinkCompression(c.name); got != c.want {
+			t.Errorf("sinkCompression(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSplitPartName(t *testing.T) {
+	cases := []struct {
+		name string
+		part int
+		want string
+	}{
+		{"dump.sql", 0, "dump.0001.sql"},
+		{"dump.sql.gz", 0, "dump.0001.sql.gz"},
+		{"dump.sql.zst", 0, "dump.0001.sql.zst"},
+		{"export.gz", 0, "export.0001.gz"},
+		{"x.gz", 0, "x.0001.gz"},
+		{"dump.sql.gz", 9, "dump.0010.sql.gz"},
+		{"dump", 0, "dump.0001"},
+	}
+
+	for _, c := range cases {
+		if got := splitPartName(c.name, c.part); got != c.want {
+			t.Errorf("splitPartName(%q, %d) = %q, want %q", c.name, c.part, got, c.want)
+		}
+	}
+}
+
+func TestFilepathExt(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"dump.sql", ".sql"},
+		{"dump", ""},
+		{"a/b.sql", ".sql"},
+		{"a.b/c", ""},
+	}
+
+	for _, c := range cases {
+		if got := filepathExt(c.name); got != c.want {
+			t.Errorf("filepathExt(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"users", "`users`"},
+		{"foo`; DROP TABLE x;--", "`foo``; DROP TABLE x;--`"},
+		{"a`b", "`a``b`"},
+	}
+
+	for _, c := range cases {
+		got, err := quoteIdentifier(c.name)
+		if err != nil {
+			t.Errorf("quoteIdentifier(%q) returned error: %v", c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("quoteIdentifier(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	if _, err := quoteIdentifier("bad\x00name"); err == nil {
+		t.Errorf("quoteIdentifier with an embedded NUL byte should return an error")
+	}
+}
+
+func TestEscapeString(t *testing.T) {
+	cases := []struct {
+		value              string
+		noBackslashEscapes bool
+		want               string
+	}{
+		{`it's`, false, `it\'s`},
+		{`a\b`, false, `a\\b`},
+		{`it's`, true, `it''s`},
+		{`a\b`, true, `a\b`},
+	}
+
+	for _, c := range cases {
+		got := string(escapeString([]byte(c.value), c.noBackslashEscapes))
+		if got != c.want {
+			t.Errorf("escapeString(%q, %v) = %q, want %q", c.value, c.noBackslashEscapes, got, c.want)
+		}
+	}
+}